@@ -0,0 +1,67 @@
+/*
+ * Copyright 2018 The ThunderDB Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"time"
+
+	"gitlab.com/thunderdb/ThunderDB/metric"
+)
+
+// ReadConsistencyLevel controls how a ReadQuery is routed among the
+// database's peers.
+type ReadConsistencyLevel int
+
+const (
+	// Strong always routes reads to the leader, matching the prior
+	// behavior of sendQuery.
+	Strong ReadConsistencyLevel = iota
+	// BoundedStaleness allows a read to be served by a follower whose
+	// last metric scrape is no older than Config.StalenessBound.
+	BoundedStaleness
+	// Any routes a read to whichever peer looks healthiest, with no
+	// staleness guarantee.
+	Any
+)
+
+// Config holds the parameters used to establish a conn to a ThunderDB
+// database.
+type Config struct {
+	// DatabaseID identifies the database to connect to.
+	DatabaseID string
+	// Debug turns on verbose logging for the connection.
+	Debug bool
+	// PeersUpdateInterval is how often the conn refreshes its peer list
+	// from the block producer.
+	PeersUpdateInterval time.Duration
+	// Timeout bounds a query when the caller supplies
+	// context.Background() instead of a context carrying its own
+	// deadline.
+	Timeout time.Duration
+	// ReadConsistency selects how ReadQuerys are routed. Defaults to
+	// Strong.
+	ReadConsistency ReadConsistencyLevel
+	// StalenessBound is the maximum age of a follower's last metric
+	// scrape that BoundedStaleness will tolerate. A zero or negative
+	// bound disables the staleness check. Ignored for other consistency
+	// levels.
+	StalenessBound time.Duration
+	// Metrics, if set, is consulted to pick a healthy, sufficiently
+	// fresh follower for non-Strong reads. If nil, the conn uses a
+	// private empty map, so every read goes to the leader.
+	Metrics *metric.NodeMetricMap
+}
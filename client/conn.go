@@ -20,6 +20,7 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"fmt"
 	"math/rand"
 	"sync"
 	"sync/atomic"
@@ -29,6 +30,7 @@ import (
 	"gitlab.com/thunderdb/ThunderDB/crypto/asymmetric"
 	"gitlab.com/thunderdb/ThunderDB/crypto/kms"
 	"gitlab.com/thunderdb/ThunderDB/kayak"
+	"gitlab.com/thunderdb/ThunderDB/metric"
 	"gitlab.com/thunderdb/ThunderDB/proto"
 	"gitlab.com/thunderdb/ThunderDB/rpc"
 	"gitlab.com/thunderdb/ThunderDB/sqlchain/storage"
@@ -36,19 +38,44 @@ import (
 	wt "gitlab.com/thunderdb/ThunderDB/worker/types"
 )
 
+// loadMetric is the CPU/load metric family consulted when picking a
+// follower for a non-Strong read; its sample's TimestampMs doubles as the
+// node's last-scrape time, and nodes whose value exceeds loadThreshold are
+// skipped regardless of staleness.
+const (
+	loadMetric    = "process_cpu_load"
+	loadThreshold = 0.9
+)
+
+// ackTimeout bounds the best-effort ack sent after a query response has
+// already been received, independent of the caller's context.
+const ackTimeout = 5 * time.Second
+
 // conn implements an interface sql.Conn.
 type conn struct {
 	dbID         proto.DatabaseID
 	connectionID uint64
 	seqNo        uint64
 
-	queries   []storage.Query
+	// lastCommitIndex is the highest ResponseHeader.CommitIndex this conn
+	// has observed on a verified response, echoed back as MinCommitIndex
+	// on later reads so a follower can tell whether it has caught up.
+	lastCommitIndex uint64
+
 	peers     *kayak.Peers
 	peersLock sync.RWMutex
 	nodeID    proto.NodeID
 	privKey   *asymmetric.PrivateKey
 	pubKey    *asymmetric.PublicKey
 
+	readConsistency ReadConsistencyLevel
+	stalenessBound  time.Duration
+	nodeMetrics     *metric.NodeMetricMap
+	timeout         time.Duration
+
+	txID    string
+	txStack []*txFrame
+
 	inTransaction bool
 	closed        int32
 	closeCh       chan struct{}
@@ -83,14 +110,22 @@ func newConn(cfg *Config) (c *conn, err error) {
 		return
 	}
 
+	nodeMetrics := cfg.Metrics
+	if nodeMetrics == nil {
+		nodeMetrics = &metric.NodeMetricMap{}
+	}
+
 	c = &conn{
-		dbID:         proto.DatabaseID(cfg.DatabaseID),
-		connectionID: uint64(connID),
-		nodeID:       nodeID,
-		privKey:      privKey,
-		pubKey:       pubKey,
-		queries:      make([]storage.Query, 0),
-		closeCh:      make(chan struct{}),
+		dbID:            proto.DatabaseID(cfg.DatabaseID),
+		connectionID:    uint64(connID),
+		nodeID:          nodeID,
+		privKey:         privKey,
+		pubKey:          pubKey,
+		closeCh:         make(chan struct{}),
+		readConsistency: cfg.ReadConsistency,
+		stalenessBound:  cfg.StalenessBound,
+		nodeMetrics:     nodeMetrics,
+		timeout:         cfg.Timeout,
 	}
 
 	c.log("new conn database ", c.dbID)
@@ -164,9 +199,20 @@ func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, e
 		return nil, sql.ErrTxDone
 	}
 
-	// TODO(xq262144): make use of the ctx argument
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.txID = newTxID()
+	c.txStack = []*txFrame{newTxFrame("")}
+
+	if err := c.sendTxControl(ctx, wt.BeginTxQuery, ""); err != nil {
+		c.txID = ""
+		c.txStack = nil
+		return nil, err
+	}
+
 	c.inTransaction = true
-	c.queries = c.queries[:0]
 
 	return c, nil
 }
@@ -188,9 +234,8 @@ func (c *conn) ExecContext(ctx context.Context, query string, args []driver.Name
 		return
 	}
 
-	// TODO(xq262144): make use of the ctx argument
 	sq := convertQuery(query, args)
-	if _, err = c.addQuery(wt.WriteQuery, sq); err != nil {
+	if _, err = c.addQuery(ctx, wt.WriteQuery, sq); err != nil {
 		return
 	}
 
@@ -206,9 +251,8 @@ func (c *conn) QueryContext(ctx context.Context, query string, args []driver.Nam
 		return
 	}
 
-	// TODO(xq262144): make use of the ctx argument
 	sq := convertQuery(query, args)
-	return c.addQuery(wt.ReadQuery, sq)
+	return c.addQuery(ctx, wt.ReadQuery, sq)
 }
 
 // Commit implements the driver.Tx.Commit method.
@@ -221,19 +265,12 @@ func (c *conn) Commit() (err error) {
 		return sql.ErrTxDone
 	}
 
-	defer func() {
-		c.queries = c.queries[:0]
-		c.inTransaction = false
-	}()
+	defer c.endTransaction()
 
-	if len(c.queries) > 0 {
-		// send query
-		if _, err = c.sendQuery(wt.WriteQuery, c.queries); err != nil {
-			return
-		}
-	}
-
-	return
+	// every write was already applied to the leader's per-TxID session
+	// as it was issued, so committing is just telling the leader to make
+	// that session's effects visible.
+	return c.sendTxControl(context.Background(), wt.CommitTxQuery, "")
 }
 
 // Rollback implements the driver.Tx.Rollback method.
@@ -246,50 +283,157 @@ func (c *conn) Rollback() error {
 		return sql.ErrTxDone
 	}
 
-	defer func() {
-		c.queries = c.queries[:0]
-		c.inTransaction = false
-	}()
+	defer c.endTransaction()
 
-	if len(c.queries) == 0 {
-		return sql.ErrTxDone
-	}
+	// empty savepoint name rolls back the whole transaction
+	return c.sendTxControl(context.Background(), wt.RollbackTxQuery, "")
+}
 
-	return nil
+// endTransaction clears all transaction-local state. It is always run via
+// defer from Commit/Rollback so a send failure still leaves the conn ready
+// to start a fresh transaction rather than stuck mid-transaction.
+func (c *conn) endTransaction() {
+	c.inTransaction = false
+	c.txID = ""
+	c.txStack = nil
 }
 
-func (c *conn) addQuery(queryType wt.QueryType, query *storage.Query) (rows driver.Rows, err error) {
+func (c *conn) addQuery(ctx context.Context, queryType wt.QueryType, query *storage.Query) (rows driver.Rows, err error) {
 	if c.inTransaction {
-		// check query type, enqueue query
+		if kind, name, ok := parseSavepointStmt(query.Pattern); ok {
+			return nil, c.handleSavepointStmt(ctx, kind, name)
+		}
+
 		if queryType == wt.ReadQuery {
-			// read query is not supported in transaction
-			err = ErrQueryInTransaction
+			// reads inside a transaction always go to the leader,
+			// carrying TxID, so they observe the transaction's own
+			// uncommitted writes rather than being routed to a
+			// follower that has never heard of this TxID.
+			return c.sendQuery(ctx, wt.ReadQuery, []storage.Query{*query})
+		}
+
+		// writes carry TxID and the current savepoint name so the
+		// leader's TxnSessionStore can buffer them against the right
+		// frame instead of applying them to storage directly; later
+		// reads and a final commit both go through that same buffer.
+		return c.sendQuery(ctx, wt.WriteQuery, []storage.Query{*query})
+	}
+
+	return c.sendQuery(ctx, queryType, []storage.Query{*query})
+}
+
+// handleSavepointStmt applies a SAVEPOINT/RELEASE/ROLLBACK TO statement
+// parsed out of an Exec call. kind is one of "SAVEPOINT", "RELEASE" or
+// "ROLLBACK" as returned by parseSavepointStmt.
+func (c *conn) handleSavepointStmt(ctx context.Context, kind, name string) (err error) {
+	switch kind {
+	case "SAVEPOINT":
+		if err = c.sendTxControl(ctx, wt.SavepointQuery, name); err != nil {
 			return
 		}
+		c.txStack = append(c.txStack, newTxFrame(name))
+		return nil
 
-		// append queries
-		c.queries = append(c.queries, *query)
-		return
+	case "RELEASE":
+		newStack, err := releaseTxFrame(c.txStack, name)
+		if err != nil {
+			return err
+		}
+
+		if err = c.sendTxControl(ctx, wt.ReleaseQuery, name); err != nil {
+			return err
+		}
+
+		// releasing a savepoint also destroys every savepoint nested
+		// after it (standard SAVEPOINT semantics); the leader's
+		// TxnSessionStore.Release folds their writes into the parent
+		// frame rather than undoing them -- c.txStack only needs to
+		// mirror which frames are still live.
+		c.txStack = newStack
+		return nil
+
+	case "ROLLBACK":
+		newStack, err := rollbackToTxFrame(c.txStack, name)
+		if err != nil {
+			return err
+		}
+
+		if err = c.sendTxControl(ctx, wt.RollbackTxQuery, name); err != nil {
+			return err
+		}
+
+		// the savepoint itself stays live for further use; only the
+		// frames nested after it, and the writes the leader's
+		// TxnSessionStore.RollbackTo discards along with them, are
+		// gone.
+		c.txStack = newStack
+		return nil
+
+	default:
+		return fmt.Errorf("client: unrecognized savepoint statement kind %q", kind)
 	}
+}
 
-	return c.sendQuery(queryType, []storage.Query{*query})
+// withTimeout derives a context carrying c.timeout when ctx has no deadline
+// of its own, so a query issued with context.Background() still bounds its
+// RPC round-trip. The returned cancel must always be called.
+func (c *conn) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, hasDeadline := ctx.Deadline(); hasDeadline || c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
 }
 
-func (c *conn) sendQuery(queryType wt.QueryType, queries []storage.Query) (rows driver.Rows, err error) {
+func (c *conn) sendQuery(ctx context.Context, queryType wt.QueryType, queries []storage.Query) (rows driver.Rows, err error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
 	c.peersLock.RLock()
 	defer c.peersLock.RUnlock()
 
+	target := c.peers.Leader.ID
+	fromFollower := false
+
+	// a transaction's reads and writes only make sense against the
+	// leader, which is the only node holding the per-TxID session.
+	if queryType == wt.ReadQuery && c.readConsistency != Strong && !c.inTransaction {
+		if followerID, ok := c.pickFollower(); ok {
+			target = followerID
+			fromFollower = true
+		} else {
+			c.log(ErrNoEligibleFollower.Error() + ", falling back to leader")
+		}
+	}
+
+	// a write issued under a SAVEPOINT names the frame it belongs to, so
+	// the leader's TxnSessionStore.AddWrite buffers it there rather than
+	// in the root frame.
+	var savepointName string
+	if c.inTransaction {
+		savepointName = c.txStack[len(c.txStack)-1].savepoint
+	}
+
 	// build request
 	seqNo := atomic.AddUint64(&c.seqNo, 1)
 	req := &wt.Request{
 		Header: wt.SignedRequestHeader{
 			RequestHeader: wt.RequestHeader{
-				QueryType:    queryType,
-				NodeID:       c.nodeID,
-				DatabaseID:   c.dbID,
-				ConnectionID: c.connectionID,
-				SeqNo:        seqNo,
-				Timestamp:    getLocalTime(),
+				QueryType:     queryType,
+				NodeID:        c.nodeID,
+				DatabaseID:    c.dbID,
+				ConnectionID:  c.connectionID,
+				SeqNo:         seqNo,
+				Timestamp:     getLocalTime(),
+				TxID:          c.txID,
+				SavepointName: savepointName,
+				// MinCommitIndex lets a follower reject (rather than
+				// silently serve stale data) when it has not yet
+				// applied up to the commit position the client itself
+				// last observed, echoed back on a prior response's
+				// CommitIndex -- not a count of queries the client
+				// happens to have issued, which bears no relation to
+				// how far the database has actually progressed.
+				MinCommitIndex: atomic.LoadUint64(&c.lastCommitIndex),
 			},
 			Signee: c.pubKey,
 		},
@@ -303,8 +447,18 @@ func (c *conn) sendQuery(queryType wt.QueryType, queries []storage.Query) (rows
 	}
 
 	var response wt.Response
-	if err = rpc.NewCaller().CallNode(c.peers.Leader.ID, "DBS.Query", req, &response); err != nil {
-		return
+	if err = rpc.NewCaller().CallNodeContext(ctx, target, "DBS.Query", req, &response); err != nil {
+		if fromFollower && isStaleReadErr(err) {
+			c.log("follower ", target, " reported stale read, falling back to leader")
+			target = c.peers.Leader.ID
+			if err = rpc.NewCaller().CallNodeContext(ctx, target, "DBS.Query", req, &response); err != nil {
+				err = translateCtxErr(ctx, err)
+				return
+			}
+		} else {
+			err = translateCtxErr(ctx, err)
+			return
+		}
 	}
 
 	// verify response
@@ -312,6 +466,8 @@ func (c *conn) sendQuery(queryType wt.QueryType, queries []storage.Query) (rows
 		return
 	}
 
+	advanceCommitIndex(&c.lastCommitIndex, response.Header.CommitIndex)
+
 	// build ack
 	ack := &wt.Ack{
 		Header: wt.SignedAckHeader{
@@ -330,9 +486,18 @@ func (c *conn) sendQuery(queryType wt.QueryType, queries []storage.Query) (rows
 
 	var ackRes wt.AckResponse
 
-	// send ack back
-	if err = rpc.NewCaller().CallNode(c.peers.Leader.ID, "DBS.Ack", ack, &ackRes); err != nil {
-		return
+	// The response has already been received at this point, so the ack
+	// is sent on its own short-lived context rather than the caller's
+	// (possibly already canceled) ctx -- otherwise a canceled query
+	// would leave the server holding a response it believes is
+	// unacknowledged. A failure here is logged, not surfaced, since the
+	// query itself already succeeded.
+	ackCtx, ackCancel := context.WithTimeout(context.Background(), ackTimeout)
+	defer ackCancel()
+
+	if err = rpc.NewCaller().CallNodeContext(ackCtx, target, "DBS.Ack", ack, &ackRes); err != nil {
+		c.log("ack failed ", err.Error())
+		err = nil
 	}
 
 	rows = newRows(&response)
@@ -340,6 +505,167 @@ func (c *conn) sendQuery(queryType wt.QueryType, queries []storage.Query) (rows
 	return
 }
 
+// sendTxControl sends a transaction control message (begin/commit/rollback
+// or a savepoint operation) to the leader, which holds the per-TxID
+// session. savepointName is only meaningful for wt.SavepointQuery,
+// wt.ReleaseQuery and wt.RollbackTxQuery (rollback to a specific
+// savepoint); it is empty for a whole-transaction begin/commit/rollback.
+func (c *conn) sendTxControl(ctx context.Context, queryType wt.QueryType, savepointName string) (err error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	c.peersLock.RLock()
+	defer c.peersLock.RUnlock()
+
+	seqNo := atomic.AddUint64(&c.seqNo, 1)
+	req := &wt.Request{
+		Header: wt.SignedRequestHeader{
+			RequestHeader: wt.RequestHeader{
+				QueryType:     queryType,
+				NodeID:        c.nodeID,
+				DatabaseID:    c.dbID,
+				ConnectionID:  c.connectionID,
+				SeqNo:         seqNo,
+				Timestamp:     getLocalTime(),
+				TxID:          c.txID,
+				SavepointName: savepointName,
+			},
+			Signee: c.pubKey,
+		},
+	}
+
+	if err = req.Sign(c.privKey); err != nil {
+		return
+	}
+
+	var response wt.Response
+	if err = rpc.NewCaller().CallNodeContext(ctx, c.peers.Leader.ID, "DBS.Query", req, &response); err != nil {
+		return translateCtxErr(ctx, err)
+	}
+
+	if err = response.Verify(); err != nil {
+		return
+	}
+
+	advanceCommitIndex(&c.lastCommitIndex, response.Header.CommitIndex)
+
+	return nil
+}
+
+// advanceCommitIndex bumps *dst up to commitIndex using a CAS loop, so
+// concurrent queries on the same conn never move it backwards -- a
+// response that raced ahead and was verified first must not have the
+// commit index it reported clobbered by a slower, earlier-issued query
+// landing after it.
+func advanceCommitIndex(dst *uint64, commitIndex uint64) {
+	for {
+		cur := atomic.LoadUint64(dst)
+		if commitIndex <= cur {
+			return
+		}
+		if atomic.CompareAndSwapUint64(dst, cur, commitIndex) {
+			return
+		}
+	}
+}
+
+// pickFollower selects a follower node for a non-Strong ReadQuery using the
+// latest metrics pulled into c.nodeMetrics. It rejects followers whose last
+// scrape is older than c.stalenessBound (only enforced for
+// BoundedStaleness with a positive bound) or whose CPU/load metric is over
+// loadThreshold, and reports ok=false if no peer passes the filter.
+func (c *conn) pickFollower() (nodeID proto.NodeID, ok bool) {
+	if c.peers == nil || len(c.peers.Servers) == 0 {
+		return
+	}
+
+	servers := make(map[proto.NodeID]bool, len(c.peers.Servers))
+	for _, s := range c.peers.Servers {
+		servers[s.ID] = true
+	}
+
+	now := time.Now()
+
+	healthy := c.nodeMetrics.FilterNode(func(id proto.NodeID, mm metric.MetricMap) bool {
+		if id == c.peers.Leader.ID || !servers[id] {
+			return false
+		}
+
+		load, found := metricGaugeValue(mm, loadMetric)
+		if found && load > loadThreshold {
+			return false
+		}
+
+		if c.readConsistency == BoundedStaleness && c.stalenessBound > 0 {
+			scrapedAt, found := metricSampleTime(mm, loadMetric)
+			if !found || now.Sub(scrapedAt) > c.stalenessBound {
+				return false
+			}
+		}
+
+		return true
+	})
+
+	if len(healthy) == 0 {
+		return
+	}
+
+	// any of the surviving, equally-eligible followers will do.
+	return healthy[rand.Intn(len(healthy))], true
+}
+
+// metricGaugeValue returns the value of a gauge-typed metric family, if
+// present.
+func metricGaugeValue(mm metric.MetricMap, name string) (value float64, ok bool) {
+	mf, exists := mm[name]
+	if !exists || len(mf.GetMetric()) == 0 {
+		return
+	}
+	return mf.GetMetric()[0].GetGauge().GetValue(), true
+}
+
+// metricSampleTime returns the wall-clock time a metric family's first
+// sample was scraped at, if the sample carries a timestamp.
+func metricSampleTime(mm metric.MetricMap, name string) (t time.Time, ok bool) {
+	mf, exists := mm[name]
+	if !exists || len(mf.GetMetric()) == 0 {
+		return
+	}
+	ts := mf.GetMetric()[0].TimestampMs
+	if ts == nil {
+		return
+	}
+	return time.Unix(0, *ts*int64(time.Millisecond)), true
+}
+
+// translateCtxErr maps a failed RPC into the error database/sql expects:
+// context.Canceled/context.DeadlineExceeded if ctx is why the call failed,
+// so database/sql can distinguish a caller-initiated cancellation from a
+// genuine connection fault, and driver.ErrBadConn otherwise so the pool
+// discards the conn instead of reusing a stream left in an unknown state.
+func translateCtxErr(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return context.Canceled
+	case context.DeadlineExceeded:
+		return context.DeadlineExceeded
+	default:
+		return driver.ErrBadConn
+	}
+}
+
+// isStaleReadErr reports whether err is the follower's rejection of a
+// BoundedStaleness read that it could not yet satisfy. RPC errors cross the
+// wire as plain strings, so match on the sentinel's message rather than
+// its type.
+func isStaleReadErr(err error) bool {
+	return err != nil && err.Error() == ErrStaleRead.Error()
+}
+
 func (c *conn) getPeers() (err error) {
 	c.peersLock.Lock()
 	defer c.peersLock.Unlock()
@@ -374,4 +700,4 @@ func convertQuery(query string, args []driver.NamedValue) (sq *storage.Query) {
 	}
 
 	return
-}
\ No newline at end of file
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2018 The ThunderDB Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/thunderdb/ThunderDB/kayak"
+	"gitlab.com/thunderdb/ThunderDB/metric"
+	"gitlab.com/thunderdb/ThunderDB/proto"
+)
+
+var errTest = errors.New("client: test error")
+
+func TestAdvanceCommitIndex(t *testing.T) {
+	Convey("advanceCommitIndex only ever moves the index forward", t, func() {
+		var idx uint64
+
+		advanceCommitIndex(&idx, 5)
+		So(atomic.LoadUint64(&idx), ShouldEqual, uint64(5))
+
+		// a smaller, presumably out-of-order, commit index must never
+		// move idx backwards.
+		advanceCommitIndex(&idx, 3)
+		So(atomic.LoadUint64(&idx), ShouldEqual, uint64(5))
+
+		advanceCommitIndex(&idx, 9)
+		So(atomic.LoadUint64(&idx), ShouldEqual, uint64(9))
+	})
+}
+
+func TestTranslateCtxErr(t *testing.T) {
+	Convey("translateCtxErr maps a failed RPC using why ctx ended, not err itself", t, func() {
+		So(translateCtxErr(context.Background(), nil), ShouldBeNil)
+
+		canceled, cancel := context.WithCancel(context.Background())
+		cancel()
+		So(translateCtxErr(canceled, errTest), ShouldEqual, context.Canceled)
+
+		timedOut, cancel := context.WithTimeout(context.Background(), 0)
+		defer cancel()
+		time.Sleep(time.Millisecond)
+		So(translateCtxErr(timedOut, errTest), ShouldEqual, context.DeadlineExceeded)
+
+		So(translateCtxErr(context.Background(), errTest), ShouldEqual, driver.ErrBadConn)
+	})
+}
+
+func TestPickFollower(t *testing.T) {
+	// NoPeers verifies a conn that has never heard back from the block
+	// producer (c.peers still nil) reports no eligible follower instead
+	// of panicking on a nil dereference.
+	Convey("pickFollower reports !ok instead of panicking when c.peers is nil", t, func() {
+		c := &conn{nodeMetrics: &metric.NodeMetricMap{}}
+		_, ok := c.pickFollower()
+		So(ok, ShouldBeFalse)
+	})
+
+	// FiltersUnhealthy verifies pickFollower excludes the leader itself, a
+	// follower reporting an over-threshold load, and -- under
+	// BoundedStaleness -- a follower whose last scrape is older than the
+	// staleness bound, leaving only genuinely eligible followers to
+	// choose from.
+	Convey("pickFollower excludes the leader and unhealthy/stale followers", t, func() {
+		leader := proto.NodeID("leader")
+		overloaded := proto.NodeID("overloaded")
+		stale := proto.NodeID("stale")
+		healthy := proto.NodeID("healthy")
+
+		c := &conn{
+			peers: &kayak.Peers{
+				Leader:  kayak.Server{ID: leader},
+				Servers: []kayak.Server{{ID: leader}, {ID: overloaded}, {ID: stale}, {ID: healthy}},
+			},
+			nodeMetrics:     &metric.NodeMetricMap{},
+			readConsistency: BoundedStaleness,
+			stalenessBound:  time.Minute,
+		}
+
+		now := time.Now()
+		c.nodeMetrics.Store(leader, metric.MetricMap{loadMetric: gaugeFamily(0.1, now)})
+		c.nodeMetrics.Store(overloaded, metric.MetricMap{loadMetric: gaugeFamily(0.99, now)})
+		c.nodeMetrics.Store(stale, metric.MetricMap{loadMetric: gaugeFamily(0.1, now.Add(-time.Hour))})
+		c.nodeMetrics.Store(healthy, metric.MetricMap{loadMetric: gaugeFamily(0.1, now)})
+
+		for i := 0; i < 10; i++ {
+			got, ok := c.pickFollower()
+			So(ok, ShouldBeTrue)
+			So(got, ShouldEqual, healthy)
+		}
+	})
+}
+
+func gaugeFamily(value float64, scrapedAt time.Time) *dto.MetricFamily {
+	ts := scrapedAt.UnixNano() / int64(time.Millisecond)
+	return &dto.MetricFamily{
+		Metric: []*dto.Metric{
+			{
+				Gauge:       &dto.Gauge{Value: &value},
+				TimestampMs: &ts,
+			},
+		},
+	}
+}
@@ -0,0 +1,30 @@
+/*
+ * Copyright 2018 The ThunderDB Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import "errors"
+
+var (
+	// ErrStaleRead indicates the follower picked for a BoundedStaleness
+	// read could not satisfy the client's minimum commit index/timestamp
+	// and the caller should retry against the leader.
+	ErrStaleRead = errors.New("follower could not satisfy read staleness bound")
+	// ErrNoEligibleFollower indicates no peer passed the follower health
+	// filter for a non-Strong read; conn.sendQuery logs it and falls back
+	// to the leader rather than surfacing it to the caller.
+	ErrNoEligibleFollower = errors.New("no eligible follower for read")
+)
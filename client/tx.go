@@ -0,0 +1,110 @@
+/*
+ * Copyright 2018 The ThunderDB Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// txFrame names one level of a transaction's savepoint stack. The root
+// frame (opened by BeginTx) has an empty savepoint name; every nested
+// SAVEPOINT statement pushes another frame. The writes themselves are
+// buffered leader-side, keyed by the frame's savepoint under the
+// connection's TxID (see worker.TxnSessionStore), not tracked here.
+type txFrame struct {
+	savepoint string
+}
+
+func newTxFrame(savepoint string) *txFrame {
+	return &txFrame{savepoint: savepoint}
+}
+
+// findTxFrame returns the index of the frame named savepoint, searching
+// from the top of the stack, or -1 if no frame has that name.
+func findTxFrame(stack []*txFrame, savepoint string) int {
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].savepoint == savepoint {
+			return i
+		}
+	}
+	return -1
+}
+
+// releaseTxFrame drops name and every frame nested after it from stack,
+// mirroring the fold-into-parent semantics of RELEASE SAVEPOINT (the
+// writes themselves fold on the leader, via worker.TxnSessionStore.Release;
+// here we only need to mirror which frames are still live).
+func releaseTxFrame(stack []*txFrame, name string) ([]*txFrame, error) {
+	idx := findTxFrame(stack, name)
+	if idx <= 0 {
+		return nil, fmt.Errorf("client: no such savepoint %q", name)
+	}
+	return stack[:idx], nil
+}
+
+// rollbackToTxFrame drops every frame nested after name from stack,
+// keeping name itself live for further use.
+func rollbackToTxFrame(stack []*txFrame, name string) ([]*txFrame, error) {
+	idx := findTxFrame(stack, name)
+	if idx <= 0 {
+		return nil, fmt.Errorf("client: no such savepoint %q", name)
+	}
+	return stack[:idx+1], nil
+}
+
+// newTxID generates a client-side unique transaction id, sent to the
+// leader so it can key its per-transaction session.
+func newTxID() string {
+	var b [16]byte
+	// crypto/rand.Read on the package-level Reader never returns a
+	// partial read without an error, so err can only mean the system
+	// entropy source is unavailable -- not worth carrying into every
+	// BeginTx call's error path.
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("client: failed to generate transaction id: " + err.Error())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+var (
+	savepointStmt  = regexp.MustCompile(`(?i)^\s*SAVEPOINT\s+(\S+)\s*;?\s*$`)
+	releaseStmt    = regexp.MustCompile(`(?i)^\s*RELEASE\s+(?:SAVEPOINT\s+)?(\S+)\s*;?\s*$`)
+	rollbackToStmt = regexp.MustCompile(`(?i)^\s*ROLLBACK\s+TO\s+(?:SAVEPOINT\s+)?(\S+)\s*;?\s*$`)
+)
+
+// parseSavepointStmt recognizes SAVEPOINT/RELEASE/ROLLBACK TO statements
+// passed to Conn.Exec so conn.addQuery can handle them locally instead of
+// forwarding them as ordinary writes.
+func parseSavepointStmt(pattern string) (kind, name string, ok bool) {
+	trimmed := strings.TrimSpace(pattern)
+
+	if m := savepointStmt.FindStringSubmatch(trimmed); m != nil {
+		return "SAVEPOINT", m[1], true
+	}
+	if m := releaseStmt.FindStringSubmatch(trimmed); m != nil {
+		return "RELEASE", m[1], true
+	}
+	if m := rollbackToStmt.FindStringSubmatch(trimmed); m != nil {
+		return "ROLLBACK", m[1], true
+	}
+
+	return "", "", false
+}
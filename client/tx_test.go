@@ -0,0 +1,91 @@
+/*
+ * Copyright 2018 The ThunderDB Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseSavepointStmt(t *testing.T) {
+	Convey("parseSavepointStmt recognizes SAVEPOINT/RELEASE/ROLLBACK TO statements", t, func() {
+		cases := []struct {
+			pattern  string
+			wantKind string
+			wantName string
+			wantOK   bool
+		}{
+			{"SAVEPOINT a", "SAVEPOINT", "a", true},
+			{"  savepoint  foo ;", "SAVEPOINT", "foo", true},
+			{"RELEASE a", "RELEASE", "a", true},
+			{"RELEASE SAVEPOINT a", "RELEASE", "a", true},
+			{"ROLLBACK TO a", "ROLLBACK", "a", true},
+			{"ROLLBACK TO SAVEPOINT a", "ROLLBACK", "a", true},
+			{"SELECT 1", "", "", false},
+			{"ROLLBACK", "", "", false},
+		}
+
+		for _, c := range cases {
+			kind, name, ok := parseSavepointStmt(c.pattern)
+			So(ok, ShouldEqual, c.wantOK)
+			So(kind, ShouldEqual, c.wantKind)
+			So(name, ShouldEqual, c.wantName)
+		}
+	})
+}
+
+func TestFindTxFrame(t *testing.T) {
+	Convey("findTxFrame returns the index of the topmost frame with a matching name", t, func() {
+		stack := []*txFrame{newTxFrame(""), newTxFrame("a"), newTxFrame("b")}
+
+		So(findTxFrame(stack, "b"), ShouldEqual, 2)
+		So(findTxFrame(stack, "a"), ShouldEqual, 1)
+		So(findTxFrame(stack, ""), ShouldEqual, 0)
+		So(findTxFrame(stack, "missing"), ShouldEqual, -1)
+	})
+}
+
+func TestReleaseTxFrame(t *testing.T) {
+	// releaseTxFrame backs conn.handleSavepointStmt's "RELEASE" branch:
+	// releasing a savepoint must also drop every savepoint established
+	// after it, not just the matched one.
+	Convey("releaseTxFrame drops the named savepoint and every frame nested after it", t, func() {
+		stack := []*txFrame{newTxFrame(""), newTxFrame("a"), newTxFrame("b")}
+
+		stack, err := releaseTxFrame(stack, "a")
+		So(err, ShouldBeNil)
+		So(stack, ShouldHaveLength, 1)
+
+		_, err = releaseTxFrame(stack, "b")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestRollbackToTxFrame(t *testing.T) {
+	// rollbackToTxFrame backs conn.handleSavepointStmt's "ROLLBACK"
+	// branch: rolling back to a savepoint must keep that savepoint itself
+	// live while discarding nested ones.
+	Convey("rollbackToTxFrame keeps the target savepoint while discarding nested ones", t, func() {
+		stack := []*txFrame{newTxFrame(""), newTxFrame("a"), newTxFrame("b")}
+
+		stack, err := rollbackToTxFrame(stack, "a")
+		So(err, ShouldBeNil)
+		So(stack, ShouldHaveLength, 2)
+		So(stack[1].savepoint, ShouldEqual, "a")
+	})
+}
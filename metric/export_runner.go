@@ -0,0 +1,73 @@
+/*
+ * Copyright 2018 The ThunderDB Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metric
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/thunderdb/ThunderDB/proto"
+	"gitlab.com/thunderdb/ThunderDB/utils/log"
+)
+
+// defaultExportInterval is used by RunExporters when no interval is given.
+const defaultExportInterval = 15 * time.Second
+
+// RunExporters periodically snapshots cs.NodeMetric and pushes it through
+// each of exporters, applying filters (e.g. relabeling/dropping nodes) to
+// every exporter's input. It blocks until ctx is done, so callers should
+// invoke it in its own goroutine.
+func (cs *CollectServer) RunExporters(ctx context.Context, interval time.Duration, exporters []Exporter, filters ...FilterFunc) {
+	if interval <= 0 {
+		interval = defaultExportInterval
+	}
+
+	filter := chainFilters(filters...)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cs.exportOnce(ctx, exporters, filter)
+	}
+}
+
+// exportOnce snapshots the currently collected node metrics and hands them
+// to every exporter in turn. A single exporter's failure does not stop the
+// others from running.
+func (cs *CollectServer) exportOnce(ctx context.Context, exporters []Exporter, filter FilterFunc) {
+	nodes := cs.NodeMetric.FilterNode(func(key proto.NodeID, value MetricMap) bool {
+		return filter == nil || filter(key, value)
+	})
+
+	snapshot := cs.NodeMetric.GetMetrics(nodes)
+	if len(snapshot) == 0 {
+		return
+	}
+
+	for _, exporter := range exporters {
+		if err := exporter.Export(ctx, snapshot); err != nil {
+			log.Warningf("metric export failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright 2018 The ThunderDB Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metric
+
+import (
+	"context"
+
+	"gitlab.com/thunderdb/ThunderDB/proto"
+)
+
+// Exporter knows how to ship a snapshot of collected node metrics to an
+// external time-series/observability system. Implementations must be safe
+// for repeated, sequential calls from CollectServer's export loop.
+type Exporter interface {
+	// Export pushes metrics keyed by node id to the backend. It should
+	// return a non-nil error if the push failed so the caller can retry
+	// on the next tick, but must not retain the passed in map.
+	Export(ctx context.Context, metrics map[proto.NodeID]MetricMap) error
+}
+
+// chainFilters combines multiple FilterFuncs into one FilterFunc that drops
+// a node's metrics unless every filter accepts it. An empty chain accepts
+// all nodes.
+func chainFilters(filters ...FilterFunc) FilterFunc {
+	return func(key proto.NodeID, value MetricMap) bool {
+		for _, f := range filters {
+			if f == nil {
+				continue
+			}
+			if !f(key, value) {
+				return false
+			}
+		}
+		return true
+	}
+}
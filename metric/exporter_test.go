@@ -0,0 +1,179 @@
+/*
+ * Copyright 2018 The ThunderDB Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metric
+
+import (
+	"math"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/prometheus/prompb"
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/thunderdb/ThunderDB/proto"
+)
+
+func prompbLabel(name, value string) prompb.Label {
+	return prompb.Label{Name: name, Value: value}
+}
+
+func gaugeMetricFamily(name string, value float64) MetricMap {
+	typ := dto.MetricType_GAUGE
+	return MetricMap{
+		name: &dto.MetricFamily{
+			Type: &typ,
+			Metric: []*dto.Metric{
+				{Gauge: &dto.Gauge{Value: &value}},
+			},
+		},
+	}
+}
+
+func TestSamplesForMetric(t *testing.T) {
+	Convey("samplesForMetric extracts the value carried by each metric type", t, func() {
+		counterValue, gaugeValue, sum := 1.0, 2.0, 3.0
+
+		So(samplesForMetric(dto.MetricType_COUNTER, &dto.Metric{Counter: &dto.Counter{Value: &counterValue}}), ShouldResemble, []float64{1.0})
+		So(samplesForMetric(dto.MetricType_GAUGE, &dto.Metric{Gauge: &dto.Gauge{Value: &gaugeValue}}), ShouldResemble, []float64{2.0})
+		So(samplesForMetric(dto.MetricType_HISTOGRAM, &dto.Metric{Histogram: &dto.Histogram{SampleSum: &sum}}), ShouldResemble, []float64{3.0})
+		So(samplesForMetric(dto.MetricType_SUMMARY, &dto.Metric{Summary: &dto.Summary{SampleSum: &sum}}), ShouldResemble, []float64{3.0})
+	})
+}
+
+func TestBuildTimeSeries(t *testing.T) {
+	Convey("buildTimeSeries flattens a node's metrics, tagging each sample with its node id", t, func() {
+		metrics := map[proto.NodeID]MetricMap{
+			"node1": gaugeMetricFamily("load", 0.5),
+		}
+
+		series := buildTimeSeries(metrics, nil)
+
+		So(series, ShouldHaveLength, 1)
+		So(series[0].Samples, ShouldHaveLength, 1)
+		So(series[0].Samples[0].Value, ShouldEqual, 0.5)
+		So(series[0].Labels, ShouldContain, prompbLabel("__name__", "load"))
+		So(series[0].Labels, ShouldContain, prompbLabel("node_id", "node1"))
+	})
+
+	Convey("buildTimeSeries drops nodes rejected by filter", t, func() {
+		metrics := map[proto.NodeID]MetricMap{
+			"node1": gaugeMetricFamily("load", 0.5),
+		}
+
+		series := buildTimeSeries(metrics, func(id proto.NodeID, mm MetricMap) bool { return false })
+
+		So(series, ShouldBeEmpty)
+	})
+}
+
+func TestConvertMetricFamily(t *testing.T) {
+	Convey("convertMetricFamily maps a gauge family to an OTLP gauge metric", t, func() {
+		mf := gaugeMetricFamily("load", 0.5)["load"]
+
+		m := convertMetricFamily("load", mf, 1000)
+
+		So(m.GetName(), ShouldEqual, "load")
+		gauge := m.GetGauge()
+		So(gauge, ShouldNotBeNil)
+		So(gauge.DataPoints, ShouldHaveLength, 1)
+		So(gauge.DataPoints[0].GetAsDouble(), ShouldEqual, 0.5)
+		So(gauge.DataPoints[0].TimeUnixNano, ShouldEqual, uint64(1000))
+	})
+
+	Convey("convertMetricFamily returns nil for an unrecognized metric type", t, func() {
+		unknown := dto.MetricType(99)
+		So(convertMetricFamily("mystery", &dto.MetricFamily{Type: &unknown}, 0), ShouldBeNil)
+	})
+
+	Convey("convertMetricFamily maps a histogram family to OTLP's non-cumulative, +Inf-free bucket shape", t, func() {
+		typ := dto.MetricType_HISTOGRAM
+		sum, count := 12.5, uint64(10)
+		bound1, bound2, boundInf := 0.1, 0.5, math.Inf(1)
+		cum1, cum2, cumInf := uint64(3), uint64(7), uint64(10)
+		mf := &dto.MetricFamily{
+			Type: &typ,
+			Metric: []*dto.Metric{
+				{
+					Histogram: &dto.Histogram{
+						SampleSum:   &sum,
+						SampleCount: &count,
+						Bucket: []*dto.Bucket{
+							{UpperBound: &bound1, CumulativeCount: &cum1},
+							{UpperBound: &bound2, CumulativeCount: &cum2},
+							{UpperBound: &boundInf, CumulativeCount: &cumInf},
+						},
+					},
+				},
+			},
+		}
+
+		m := convertMetricFamily("latency", mf, 1000)
+
+		histogram := m.GetHistogram()
+		So(histogram, ShouldNotBeNil)
+		So(histogram.DataPoints, ShouldHaveLength, 1)
+
+		dp := histogram.DataPoints[0]
+		So(dp.ExplicitBounds, ShouldResemble, []float64{0.1, 0.5})
+		So(dp.BucketCounts, ShouldResemble, []uint64{3, 4, 3})
+		So(dp.Count, ShouldEqual, uint64(10))
+		So(dp.GetSum(), ShouldEqual, 12.5)
+	})
+}
+
+func TestNonNegativeDelta(t *testing.T) {
+	Convey("nonNegativeDelta subtracts normally and clamps to 0 rather than underflowing", t, func() {
+		So(nonNegativeDelta(7, 3), ShouldEqual, uint64(4))
+		So(nonNegativeDelta(3, 7), ShouldEqual, uint64(0))
+	})
+}
+
+func TestBuildResourceMetrics(t *testing.T) {
+	Convey("buildResourceMetrics tags each node's metrics with a node.id resource attribute", t, func() {
+		metrics := map[proto.NodeID]MetricMap{
+			"node1": gaugeMetricFamily("load", 0.5),
+		}
+
+		rms := buildResourceMetrics(metrics, nil)
+
+		So(rms, ShouldHaveLength, 1)
+		So(rms[0].Resource.Attributes, ShouldHaveLength, 1)
+		So(rms[0].Resource.Attributes[0].Key, ShouldEqual, "node.id")
+		So(rms[0].Resource.Attributes[0].Value.GetStringValue(), ShouldEqual, "node1")
+		So(rms[0].ScopeMetrics[0].Metrics, ShouldHaveLength, 1)
+	})
+
+	Convey("buildResourceMetrics drops nodes rejected by filter", t, func() {
+		metrics := map[proto.NodeID]MetricMap{
+			"node1": gaugeMetricFamily("load", 0.5),
+		}
+
+		rms := buildResourceMetrics(metrics, func(id proto.NodeID, mm MetricMap) bool { return false })
+
+		So(rms, ShouldBeEmpty)
+	})
+}
+
+func TestLabelsToAttributes(t *testing.T) {
+	Convey("labelsToAttributes converts each dto label pair to an OTLP string attribute", t, func() {
+		name, value := "region", "us-west"
+		attrs := labelsToAttributes([]*dto.LabelPair{{Name: &name, Value: &value}})
+
+		So(attrs, ShouldHaveLength, 1)
+		So(attrs[0].Key, ShouldEqual, "region")
+		So(attrs[0].Value.GetStringValue(), ShouldEqual, "us-west")
+	})
+}
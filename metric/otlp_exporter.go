@@ -0,0 +1,260 @@
+/*
+ * Copyright 2018 The ThunderDB Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metric
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+
+	tdbproto "gitlab.com/thunderdb/ThunderDB/proto"
+	"gitlab.com/thunderdb/ThunderDB/utils/log"
+)
+
+const (
+	// defaultOTLPTimeout bounds a single export POST.
+	defaultOTLPTimeout = 10 * time.Second
+)
+
+// OTLPExporterConfig configures an OTLPExporter.
+type OTLPExporterConfig struct {
+	// Endpoint is the OTLP/HTTP metrics collector URL, e.g.
+	// "http://otel-collector:4318/v1/metrics".
+	Endpoint string
+	// Timeout bounds each POST. Defaults to defaultOTLPTimeout.
+	Timeout time.Duration
+	// Filter, if set, drops nodes for which it returns false.
+	Filter FilterFunc
+}
+
+// OTLPExporter maps collected MetricMaps to OTLP Metric messages, one
+// ResourceMetrics per node, and pushes them to an OTLP/HTTP collector.
+type OTLPExporter struct {
+	cfg    OTLPExporterConfig
+	client *http.Client
+}
+
+// NewOTLPExporter returns an Exporter that pushes to cfg.Endpoint.
+func NewOTLPExporter(cfg OTLPExporterConfig) *OTLPExporter {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultOTLPTimeout
+	}
+
+	return &OTLPExporter{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// Export implements Exporter.
+func (e *OTLPExporter) Export(ctx context.Context, metrics map[tdbproto.NodeID]MetricMap) (err error) {
+	req := &collectorpb.ExportMetricsServiceRequest{
+		ResourceMetrics: buildResourceMetrics(metrics, e.cfg.Filter),
+	}
+
+	if len(req.ResourceMetrics) == 0 {
+		return nil
+	}
+
+	var body []byte
+	if body, err = proto.Marshal(req); err != nil {
+		return fmt.Errorf("marshal export request: %w", err)
+	}
+
+	var httpReq *http.Request
+	if httpReq, err = http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.Endpoint, bytes.NewReader(body)); err != nil {
+		return
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+
+	var resp *http.Response
+	if resp, err = e.client.Do(httpReq); err != nil {
+		return fmt.Errorf("otlp export request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		err = fmt.Errorf("otlp collector returned status %s", resp.Status)
+		log.Warningf("otlp export failed: %v", err)
+	}
+
+	return
+}
+
+// buildResourceMetrics converts each node's MetricMap into a
+// ResourceMetrics tagged with a node.id resource attribute.
+func buildResourceMetrics(metrics map[tdbproto.NodeID]MetricMap, filter FilterFunc) (rms []*metricspb.ResourceMetrics) {
+	now := uint64(time.Now().UnixNano())
+
+	for nodeID, mm := range metrics {
+		if filter != nil && !filter(nodeID, mm) {
+			continue
+		}
+
+		var otlpMetrics []*metricspb.Metric
+		for name, mf := range mm {
+			if m := convertMetricFamily(name, mf, now); m != nil {
+				otlpMetrics = append(otlpMetrics, m)
+			}
+		}
+
+		if len(otlpMetrics) == 0 {
+			continue
+		}
+
+		rms = append(rms, &metricspb.ResourceMetrics{
+			Resource: &resourcepb.Resource{
+				Attributes: []*commonpb.KeyValue{
+					{
+						Key:   "node.id",
+						Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: string(nodeID)}},
+					},
+				},
+			},
+			ScopeMetrics: []*metricspb.ScopeMetrics{
+				{Metrics: otlpMetrics},
+			},
+		})
+	}
+
+	return
+}
+
+// convertMetricFamily maps a single *dto.MetricFamily to the matching OTLP
+// Metric message, keeping counters, gauges and histograms distinct rather
+// than flattening them as the Prometheus remote-write path does.
+func convertMetricFamily(name string, mf *dto.MetricFamily, now uint64) *metricspb.Metric {
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER:
+		return &metricspb.Metric{
+			Name: name,
+			Data: &metricspb.Metric_Sum{
+				Sum: &metricspb.Sum{
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					IsMonotonic:            true,
+					DataPoints:             numberDataPoints(mf, now, func(m *dto.Metric) float64 { return m.GetCounter().GetValue() }),
+				},
+			},
+		}
+	case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+		return &metricspb.Metric{
+			Name: name,
+			Data: &metricspb.Metric_Gauge{
+				Gauge: &metricspb.Gauge{
+					DataPoints: numberDataPoints(mf, now, func(m *dto.Metric) float64 {
+						if mf.GetType() == dto.MetricType_GAUGE {
+							return m.GetGauge().GetValue()
+						}
+						return m.GetUntyped().GetValue()
+					}),
+				},
+			},
+		}
+	case dto.MetricType_HISTOGRAM:
+		return &metricspb.Metric{
+			Name: name,
+			Data: &metricspb.Metric_Histogram{
+				Histogram: &metricspb.Histogram{
+					AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+					DataPoints:             histogramDataPoints(mf, now),
+				},
+			},
+		}
+	default:
+		return nil
+	}
+}
+
+func numberDataPoints(mf *dto.MetricFamily, now uint64, value func(*dto.Metric) float64) (dps []*metricspb.NumberDataPoint) {
+	for _, m := range mf.GetMetric() {
+		dps = append(dps, &metricspb.NumberDataPoint{
+			Attributes:   labelsToAttributes(m.GetLabel()),
+			TimeUnixNano: now,
+			Value:        &metricspb.NumberDataPoint_AsDouble{AsDouble: value(m)},
+		})
+	}
+	return
+}
+
+// histogramDataPoints converts each Prometheus histogram's cumulative,
+// +Inf-terminated bucket list into OTLP's expected shape: ExplicitBounds
+// holds only the finite upper bounds, and BucketCounts holds the
+// per-bucket (not cumulative) count for each of them plus one trailing
+// entry for the count above the last bound -- so BucketCounts always has
+// exactly one more element than ExplicitBounds.
+func histogramDataPoints(mf *dto.MetricFamily, now uint64) (dps []*metricspb.HistogramDataPoint) {
+	for _, m := range mf.GetMetric() {
+		h := m.GetHistogram()
+
+		var bounds []float64
+		var counts []uint64
+		var prevCumulative uint64
+		for _, b := range h.GetBucket() {
+			if math.IsInf(b.GetUpperBound(), 1) {
+				// Prometheus sometimes makes the +Inf bucket explicit;
+				// OTLP folds it into the trailing overflow count instead
+				// of listing it as an explicit bound.
+				continue
+			}
+			bounds = append(bounds, b.GetUpperBound())
+			counts = append(counts, nonNegativeDelta(b.GetCumulativeCount(), prevCumulative))
+			prevCumulative = b.GetCumulativeCount()
+		}
+		counts = append(counts, nonNegativeDelta(h.GetSampleCount(), prevCumulative))
+
+		dps = append(dps, &metricspb.HistogramDataPoint{
+			Attributes:     labelsToAttributes(m.GetLabel()),
+			TimeUnixNano:   now,
+			Count:          h.GetSampleCount(),
+			Sum:            proto.Float64(h.GetSampleSum()),
+			BucketCounts:   counts,
+			ExplicitBounds: bounds,
+		})
+	}
+	return
+}
+
+// nonNegativeDelta returns cur-prev, or 0 if a malformed scrape left
+// cumulative bucket counts non-monotonic -- a uint64 underflow there
+// would otherwise surface as a bucket count near 2^64 instead of just a
+// wrong-but-bounded one.
+func nonNegativeDelta(cur, prev uint64) uint64 {
+	if cur < prev {
+		return 0
+	}
+	return cur - prev
+}
+
+func labelsToAttributes(labels []*dto.LabelPair) (attrs []*commonpb.KeyValue) {
+	for _, lp := range labels {
+		attrs = append(attrs, &commonpb.KeyValue{
+			Key:   lp.GetName(),
+			Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: lp.GetValue()}},
+		})
+	}
+	return
+}
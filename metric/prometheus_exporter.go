@@ -0,0 +1,199 @@
+/*
+ * Copyright 2018 The ThunderDB Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metric
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/prometheus/prompb"
+
+	tdbproto "gitlab.com/thunderdb/ThunderDB/proto"
+	"gitlab.com/thunderdb/ThunderDB/utils/log"
+)
+
+const (
+	// defaultPrometheusTimeout bounds a single remote-write POST.
+	defaultPrometheusTimeout = 10 * time.Second
+	// defaultPrometheusRetries is the number of attempts made before an
+	// Export call gives up on a write request.
+	defaultPrometheusRetries = 3
+	// defaultPrometheusBackoff is the delay between retries.
+	defaultPrometheusBackoff = time.Second
+)
+
+// PrometheusExporterConfig configures a PrometheusExporter.
+type PrometheusExporterConfig struct {
+	// URL is the Prometheus remote_write endpoint, e.g.
+	// "http://prometheus:9090/api/v1/write".
+	URL string
+	// Timeout bounds each POST. Defaults to defaultPrometheusTimeout.
+	Timeout time.Duration
+	// Retries is the number of attempts made before giving up. Defaults
+	// to defaultPrometheusRetries.
+	Retries int
+	// Backoff is the delay between retries. Defaults to
+	// defaultPrometheusBackoff.
+	Backoff time.Duration
+	// Filter, if set, drops nodes for which it returns false.
+	Filter FilterFunc
+}
+
+// PrometheusExporter converts collected MetricMaps into prompb.TimeSeries
+// and pushes them to a Prometheus remote_write endpoint.
+type PrometheusExporter struct {
+	cfg    PrometheusExporterConfig
+	client *http.Client
+}
+
+// NewPrometheusExporter returns an Exporter that remote-writes to cfg.URL.
+func NewPrometheusExporter(cfg PrometheusExporterConfig) *PrometheusExporter {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultPrometheusTimeout
+	}
+	if cfg.Retries <= 0 {
+		cfg.Retries = defaultPrometheusRetries
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = defaultPrometheusBackoff
+	}
+
+	return &PrometheusExporter{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// Export implements Exporter.
+func (e *PrometheusExporter) Export(ctx context.Context, metrics map[tdbproto.NodeID]MetricMap) (err error) {
+	wr := &prompb.WriteRequest{
+		Timeseries: buildTimeSeries(metrics, e.cfg.Filter),
+	}
+
+	if len(wr.Timeseries) == 0 {
+		return nil
+	}
+
+	var data []byte
+	if data, err = proto.Marshal(wr); err != nil {
+		return fmt.Errorf("marshal write request: %w", err)
+	}
+	compressed := snappy.Encode(nil, data)
+
+	for attempt := 0; attempt < e.cfg.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(e.cfg.Backoff):
+			}
+		}
+
+		if err = e.post(ctx, compressed); err == nil {
+			return nil
+		}
+
+		log.Warningf("prometheus remote write attempt %d failed: %v", attempt+1, err)
+	}
+
+	return fmt.Errorf("prometheus remote write giving up after %d attempts: %w", e.cfg.Retries, err)
+}
+
+func (e *PrometheusExporter) post(ctx context.Context, body []byte) (err error) {
+	var req *http.Request
+	if req, err = http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.URL, bytes.NewReader(body)); err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	var resp *http.Response
+	if resp, err = e.client.Do(req); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		err = fmt.Errorf("remote write returned status %s", resp.Status)
+	}
+
+	return
+}
+
+// buildTimeSeries flattens the per-node metric families into prompb
+// TimeSeries, tagging each sample with a node_id label and dropping nodes
+// rejected by filter.
+func buildTimeSeries(metrics map[tdbproto.NodeID]MetricMap, filter FilterFunc) (series []prompb.TimeSeries) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+
+	for nodeID, mm := range metrics {
+		if filter != nil && !filter(nodeID, mm) {
+			continue
+		}
+
+		for name, mf := range mm {
+			for _, m := range mf.GetMetric() {
+				labels := []prompb.Label{
+					{Name: "__name__", Value: name},
+					{Name: "node_id", Value: string(nodeID)},
+				}
+				for _, lp := range m.GetLabel() {
+					labels = append(labels, prompb.Label{Name: lp.GetName(), Value: lp.GetValue()})
+				}
+
+				for _, sample := range samplesForMetric(mf.GetType(), m) {
+					series = append(series, prompb.TimeSeries{
+						Labels: labels,
+						Samples: []prompb.Sample{
+							{Value: sample, Timestamp: now},
+						},
+					})
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// samplesForMetric extracts the float64 value(s) carried by a single
+// dto.Metric according to its family type. Histograms/summaries are
+// flattened to their sum; per-bucket export is left to the OTLP path,
+// which preserves bucket boundaries natively.
+func samplesForMetric(t dto.MetricType, m *dto.Metric) []float64 {
+	switch t {
+	case dto.MetricType_COUNTER:
+		return []float64{m.GetCounter().GetValue()}
+	case dto.MetricType_GAUGE:
+		return []float64{m.GetGauge().GetValue()}
+	case dto.MetricType_HISTOGRAM:
+		return []float64{m.GetHistogram().GetSampleSum()}
+	case dto.MetricType_SUMMARY:
+		return []float64{m.GetSummary().GetSampleSum()}
+	case dto.MetricType_UNTYPED:
+		return []float64{m.GetUntyped().GetValue()}
+	default:
+		return nil
+	}
+}
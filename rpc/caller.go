@@ -0,0 +1,90 @@
+/*
+ * Copyright 2018 The ThunderDB Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"context"
+	"net"
+	"net/rpc"
+
+	"gitlab.com/thunderdb/ThunderDB/proto"
+)
+
+// Dial resolves node to a connection a Caller can issue one RPC over. It
+// is a package variable so the DHT-backed session pool the rest of this
+// package maintains can install the real resolver, and so tests can
+// substitute a fake transport.
+var Dial func(node proto.NodeID) (net.Conn, error)
+
+// Caller issues RPCs against named methods exposed by other nodes in the
+// DHT. Callers carry no state of their own, so there is no need to reuse
+// one across calls.
+type Caller struct{}
+
+// NewCaller returns a ready-to-use Caller.
+func NewCaller() *Caller {
+	return &Caller{}
+}
+
+// CallNode issues method against node, blocking until a reply arrives or
+// the call fails. It is equivalent to CallNodeContext called with
+// context.Background().
+func (c *Caller) CallNode(node proto.NodeID, method string, args, reply interface{}) error {
+	return c.CallNodeContext(context.Background(), node, method, args, reply)
+}
+
+// CallNodeContext issues method against node the same way CallNode does,
+// but additionally honors ctx: the connection's deadline is set from
+// ctx's deadline (if any) before the call is sent, and a goroutine closes
+// the connection the moment ctx is done, so a canceled or timed-out
+// caller is never left blocked on the network waiting for a reply that
+// will never come.
+func (c *Caller) CallNodeContext(ctx context.Context, node proto.NodeID, method string, args, reply interface{}) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	conn, err := Dial(node)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			return
+		}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Breaks the stream the in-flight Call below is blocked
+			// reading/writing on, unblocking it immediately instead of
+			// waiting for the network to notice.
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	client := rpc.NewClient(conn)
+	defer client.Close()
+
+	return client.Call(method, args, reply)
+}
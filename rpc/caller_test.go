@@ -0,0 +1,119 @@
+/*
+ * Copyright 2018 The ThunderDB Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/rpc"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/thunderdb/ThunderDB/proto"
+)
+
+var errDial = errors.New("dial failed")
+
+type echoService struct{}
+
+func (echoService) Double(args int, reply *int) error {
+	*reply = args * 2
+	return nil
+}
+
+// withFakeDial substitutes Dial for the duration of the test, returning
+// conn for every node, and restores the original on cleanup.
+func withFakeDial(t *testing.T, conn net.Conn) {
+	t.Helper()
+	orig := Dial
+	Dial = func(proto.NodeID) (net.Conn, error) { return conn, nil }
+	t.Cleanup(func() { Dial = orig })
+}
+
+func TestCallNodeContext(t *testing.T) {
+	Convey("CallNodeContext dials the target node and returns its reply", t, func() {
+		clientConn, serverConn := net.Pipe()
+
+		server := rpc.NewServer()
+		server.RegisterName("Echo", echoService{})
+		go server.ServeConn(serverConn)
+
+		withFakeDial(t, clientConn)
+
+		var reply int
+		err := NewCaller().CallNodeContext(context.Background(), "node1", "Echo.Double", 21, &reply)
+		So(err, ShouldBeNil)
+		So(reply, ShouldEqual, 42)
+	})
+
+	Convey("CallNodeContext returns the dial error without attempting the call", t, func() {
+		orig := Dial
+		Dial = func(proto.NodeID) (net.Conn, error) { return nil, errDial }
+		defer func() { Dial = orig }()
+
+		var reply int
+		err := NewCaller().CallNodeContext(context.Background(), "node1", "Echo.Double", 1, &reply)
+		So(err, ShouldEqual, errDial)
+	})
+
+	// CancelUnblocks verifies that canceling ctx while a call is in flight
+	// unblocks CallNodeContext instead of leaving it stuck waiting on a
+	// reply the (deliberately unserved) peer will never send.
+	Convey("CallNodeContext unblocks when ctx is canceled mid-call", t, func() {
+		clientConn, serverConn := net.Pipe()
+		defer serverConn.Close()
+
+		withFakeDial(t, clientConn)
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		done := make(chan error, 1)
+		go func() {
+			var reply int
+			done <- NewCaller().CallNodeContext(ctx, "node1", "Echo.Double", 1, &reply)
+		}()
+
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+
+		select {
+		case err := <-done:
+			So(err, ShouldNotBeNil)
+		case <-time.After(time.Second):
+			t.Fatal("CallNodeContext did not unblock after ctx was canceled")
+		}
+	})
+}
+
+func TestCallNode(t *testing.T) {
+	Convey("CallNode runs CallNodeContext against context.Background", t, func() {
+		clientConn, serverConn := net.Pipe()
+
+		server := rpc.NewServer()
+		server.RegisterName("Echo", echoService{})
+		go server.ServeConn(serverConn)
+
+		withFakeDial(t, clientConn)
+
+		var reply int
+		err := NewCaller().CallNode("node1", "Echo.Double", 10, &reply)
+		So(err, ShouldBeNil)
+		So(reply, ShouldEqual, 20)
+	})
+}
@@ -0,0 +1,211 @@
+/*
+ * Copyright 2018 The ThunderDB Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package worker holds the sqlchain worker's leader-side transaction
+// bookkeeping. A DBS.Query handler for a WriteQuery carrying a TxID calls
+// TxnSessionStore.AddWrite instead of applying the write to storage
+// directly; a ReadQuery carrying the same TxID calls Writes to replay
+// those buffered statements on top of the committed database state, so a
+// transaction observes its own uncommitted writes without anyone else
+// seeing them. CommitTxQuery applies Writes(txID) to storage and calls
+// End; RollbackTxQuery/ReleaseQuery call RollbackTo/Release to drop or
+// fold the writes recorded under a savepoint, same as CommitTxQuery and
+// End close out the session.
+package worker
+
+import (
+	"errors"
+	"sync"
+
+	"gitlab.com/thunderdb/ThunderDB/sqlchain/storage"
+)
+
+var (
+	// ErrTxnAlreadyOpen is returned by TxnSessionStore.Begin for a TxID
+	// that already has an open session.
+	ErrTxnAlreadyOpen = errors.New("worker: transaction already open")
+	// ErrNoSuchTxn is returned when a TxID has no open session.
+	ErrNoSuchTxn = errors.New("worker: no such transaction")
+	// ErrNoSuchSavepoint is returned when a session has no savepoint by
+	// the given name.
+	ErrNoSuchSavepoint = errors.New("worker: no such savepoint")
+)
+
+// txnFrame holds the writes issued under one level of a transaction's
+// savepoint stack, mirroring client.txFrame on the leader. The root frame
+// (pushed by Begin) has an empty savepoint name; every Savepoint call
+// pushes another frame.
+type txnFrame struct {
+	savepoint string
+	writes    []storage.Query
+}
+
+// txnSession is one client transaction's savepoint stack on the leader:
+// frames[0] is always the unnamed root frame opened by BeginTxQuery, and
+// every SavepointQuery pushes another frame.
+type txnSession struct {
+	frames []*txnFrame
+}
+
+// TxnSessionStore holds the leader's open per-TxID transaction sessions,
+// keyed by the client-generated TxID carried on every wt.Request issued
+// inside a transaction (see client.conn.sendTxControl). It is safe for
+// concurrent use by the worker's RPC handlers.
+type TxnSessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*txnSession
+}
+
+// NewTxnSessionStore returns an empty TxnSessionStore.
+func NewTxnSessionStore() *TxnSessionStore {
+	return &TxnSessionStore{sessions: make(map[string]*txnSession)}
+}
+
+// Begin opens a new session for txID, rooted at the unnamed savepoint.
+func (s *TxnSessionStore) Begin(txID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[txID]; ok {
+		return ErrTxnAlreadyOpen
+	}
+	s.sessions[txID] = &txnSession{frames: []*txnFrame{{savepoint: ""}}}
+	return nil
+}
+
+// Savepoint pushes a new, empty frame named name onto txID's stack.
+func (s *TxnSessionStore) Savepoint(txID, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[txID]
+	if !ok {
+		return ErrNoSuchTxn
+	}
+	sess.frames = append(sess.frames, &txnFrame{savepoint: name})
+	return nil
+}
+
+// AddWrite records query against txID's current savepoint frame. It is
+// called for every WriteQuery carrying a TxID, in place of applying the
+// query to storage directly, so the write only becomes visible outside
+// the transaction once CommitTxQuery applies Writes(txID).
+func (s *TxnSessionStore) AddWrite(txID string, query storage.Query) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[txID]
+	if !ok {
+		return ErrNoSuchTxn
+	}
+	top := sess.frames[len(sess.frames)-1]
+	top.writes = append(top.writes, query)
+	return nil
+}
+
+// Writes returns every write buffered in txID's session so far, in the
+// order they were issued, flattened across all live savepoint frames. A
+// ReadQuery carrying a TxID replays these on top of the committed
+// database state; CommitTxQuery applies them verbatim.
+func (s *TxnSessionStore) Writes(txID string) ([]storage.Query, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[txID]
+	if !ok {
+		return nil, ErrNoSuchTxn
+	}
+
+	var writes []storage.Query
+	for _, frame := range sess.frames {
+		writes = append(writes, frame.writes...)
+	}
+	return writes, nil
+}
+
+// Release forgets name and every savepoint established after it in txID's
+// session, folding their writes into the parent frame rather than undoing
+// them -- same as RELEASE SAVEPOINT semantics on the client side.
+func (s *TxnSessionStore) Release(txID, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[txID]
+	if !ok {
+		return ErrNoSuchTxn
+	}
+	idx := findFrame(sess.frames, name)
+	if idx <= 0 {
+		return ErrNoSuchSavepoint
+	}
+
+	parent := sess.frames[idx-1]
+	for _, frame := range sess.frames[idx:] {
+		parent.writes = append(parent.writes, frame.writes...)
+	}
+	sess.frames = sess.frames[:idx]
+	return nil
+}
+
+// RollbackTo discards every savepoint established after name in txID's
+// session, along with the writes recorded under them. name itself, and
+// its writes, stay live for further use.
+func (s *TxnSessionStore) RollbackTo(txID, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[txID]
+	if !ok {
+		return ErrNoSuchTxn
+	}
+	idx := findFrame(sess.frames, name)
+	if idx <= 0 {
+		return ErrNoSuchSavepoint
+	}
+	sess.frames = sess.frames[:idx+1]
+	return nil
+}
+
+// End closes txID's session, discarding all of its bookkeeping. It is
+// called for a whole-transaction CommitTxQuery (after its writes have
+// been applied to storage) or a RollbackTxQuery with an empty
+// SavepointName.
+func (s *TxnSessionStore) End(txID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, txID)
+}
+
+// Has reports whether txID has an open session.
+func (s *TxnSessionStore) Has(txID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.sessions[txID]
+	return ok
+}
+
+// findFrame returns the index of the most recently established frame
+// named name, searching from the top of the stack, or -1 if none matches.
+func findFrame(frames []*txnFrame, name string) int {
+	for i := len(frames) - 1; i >= 0; i-- {
+		if frames[i].savepoint == name {
+			return i
+		}
+	}
+	return -1
+}
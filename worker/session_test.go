@@ -0,0 +1,112 @@
+/*
+ * Copyright 2018 The ThunderDB Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"gitlab.com/thunderdb/ThunderDB/sqlchain/storage"
+)
+
+func TestTxnSessionStore_BeginEnd(t *testing.T) {
+	Convey("Begin opens a session and End closes it", t, func() {
+		s := NewTxnSessionStore()
+
+		So(s.Begin("tx1"), ShouldBeNil)
+		So(s.Has("tx1"), ShouldBeTrue)
+		So(s.Begin("tx1"), ShouldEqual, ErrTxnAlreadyOpen)
+
+		s.End("tx1")
+		So(s.Has("tx1"), ShouldBeFalse)
+	})
+}
+
+func TestTxnSessionStore_UnknownTxn(t *testing.T) {
+	Convey("every per-TxID operation reports ErrNoSuchTxn for an unknown TxID", t, func() {
+		s := NewTxnSessionStore()
+
+		So(s.Savepoint("nope", "a"), ShouldEqual, ErrNoSuchTxn)
+		So(s.Release("nope", "a"), ShouldEqual, ErrNoSuchTxn)
+		So(s.RollbackTo("nope", "a"), ShouldEqual, ErrNoSuchTxn)
+		So(s.AddWrite("nope", storage.Query{Pattern: "INSERT"}), ShouldEqual, ErrNoSuchTxn)
+
+		_, err := s.Writes("nope")
+		So(err, ShouldEqual, ErrNoSuchTxn)
+	})
+}
+
+func TestTxnSessionStore_Writes(t *testing.T) {
+	// Writes is what a ReadQuery in the same transaction would replay to
+	// see the transaction's own uncommitted writes.
+	Convey("Writes flattens every buffered write in issue order, across the root frame and any open savepoints", t, func() {
+		s := NewTxnSessionStore()
+		s.Begin("tx1")
+		s.AddWrite("tx1", storage.Query{Pattern: "INSERT root"})
+		s.Savepoint("tx1", "a")
+		s.AddWrite("tx1", storage.Query{Pattern: "INSERT a"})
+
+		writes, err := s.Writes("tx1")
+		So(err, ShouldBeNil)
+		So(writes, ShouldHaveLength, 2)
+		So(writes[0].Pattern, ShouldEqual, "INSERT root")
+		So(writes[1].Pattern, ShouldEqual, "INSERT a")
+	})
+}
+
+func TestTxnSessionStore_Release(t *testing.T) {
+	Convey("Release drops every savepoint established after the named one, folding their writes into the parent", t, func() {
+		s := NewTxnSessionStore()
+		s.Begin("tx1")
+		s.Savepoint("tx1", "a")
+		s.AddWrite("tx1", storage.Query{Pattern: "INSERT a"})
+		s.Savepoint("tx1", "b")
+		s.AddWrite("tx1", storage.Query{Pattern: "INSERT b"})
+
+		So(s.Release("tx1", "a"), ShouldBeNil)
+
+		sess := s.sessions["tx1"]
+		So(sess.frames, ShouldHaveLength, 1)
+
+		writes, err := s.Writes("tx1")
+		So(err, ShouldBeNil)
+		So(writes, ShouldHaveLength, 2)
+
+		So(s.Release("tx1", "b"), ShouldEqual, ErrNoSuchSavepoint)
+	})
+}
+
+func TestTxnSessionStore_RollbackTo(t *testing.T) {
+	Convey("RollbackTo keeps the target savepoint and its writes live, discarding only nested frames", t, func() {
+		s := NewTxnSessionStore()
+		s.Begin("tx1")
+		s.Savepoint("tx1", "a")
+		s.AddWrite("tx1", storage.Query{Pattern: "INSERT a"})
+		s.Savepoint("tx1", "b")
+		s.AddWrite("tx1", storage.Query{Pattern: "INSERT b"})
+
+		So(s.RollbackTo("tx1", "a"), ShouldBeNil)
+
+		writes, err := s.Writes("tx1")
+		So(err, ShouldBeNil)
+		So(writes, ShouldHaveLength, 1)
+		So(writes[0].Pattern, ShouldEqual, "INSERT a")
+
+		// "a" is still live and can be reused.
+		So(s.Savepoint("tx1", "a"), ShouldBeNil)
+	})
+}
@@ -0,0 +1,38 @@
+/*
+ * Copyright 2018 The ThunderDB Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+// Transaction-control QueryTypes. Requests carrying one of these never
+// populate RequestPayload.Queries; the operation they perform is fully
+// described by RequestHeader.TxID and RequestHeader.SavepointName. See
+// worker.TxnSessionStore for how the leader tracks the session each of
+// these mutates.
+const (
+	// BeginTxQuery opens a new per-TxID session on the leader.
+	BeginTxQuery QueryType = iota + 100
+	// CommitTxQuery makes a session's effects visible and closes it.
+	CommitTxQuery
+	// RollbackTxQuery discards a session's effects back to
+	// SavepointName, or the whole session if SavepointName is empty, and
+	// closes the session in the latter case.
+	RollbackTxQuery
+	// SavepointQuery establishes a new named savepoint in a session.
+	SavepointQuery
+	// ReleaseQuery forgets a named savepoint and every savepoint
+	// established after it, without undoing their writes.
+	ReleaseQuery
+)
@@ -0,0 +1,248 @@
+/*
+ * Copyright 2018 The ThunderDB Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package types defines the signed request/response protocol the sqlchain
+// worker's DBS service exchanges with client.conn: a Request carries one or
+// more storage.Querys (or, for a transaction-control QueryType, no
+// payload at all) to a node's DBS.Query method, which replies with a
+// Response; the client then best-effort acknowledges receipt via a
+// separate Ack/DBS.Ack round-trip.
+package types
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"time"
+
+	"gitlab.com/thunderdb/ThunderDB/crypto/asymmetric"
+	"gitlab.com/thunderdb/ThunderDB/proto"
+	"gitlab.com/thunderdb/ThunderDB/sqlchain/storage"
+)
+
+// ErrSignatureMismatch is returned by Verify when a header's signature
+// does not match its signee.
+var ErrSignatureMismatch = errors.New("types: signature mismatch")
+
+// QueryType identifies what a Request asks a node to do.
+type QueryType int32
+
+const (
+	// ReadQuery runs Payload.Queries without side effects on the
+	// database, and may be served by a follower for non-Strong reads.
+	ReadQuery QueryType = iota
+	// WriteQuery applies Payload.Queries to the database and must be
+	// served by the leader.
+	WriteQuery
+)
+
+// RequestHeader carries identifying and routing metadata for a Request.
+type RequestHeader struct {
+	QueryType    QueryType
+	NodeID       proto.NodeID
+	DatabaseID   proto.DatabaseID
+	ConnectionID uint64
+	SeqNo        uint64
+	Timestamp    time.Time
+	// TxID is the client-generated id of the transaction this request
+	// belongs to, carried on every query issued inside a BeginTx/Commit
+	// or Rollback pair so the leader can route it to the right per-TxID
+	// session. Empty outside a transaction.
+	TxID string
+	// SavepointName names the savepoint a SavepointQuery/ReleaseQuery
+	// establishes or releases, or the one a RollbackTxQuery unwinds to.
+	// Empty for a whole-transaction BeginTxQuery/CommitTxQuery/
+	// RollbackTxQuery.
+	SavepointName string
+	// MinCommitIndex is the minimum log position the client requires the
+	// serving node to have already applied before answering a
+	// BoundedStaleness ReadQuery; see client.conn.sendQuery.
+	MinCommitIndex uint64
+}
+
+// hash returns a deterministic digest of v, used as the payload Sign signs
+// and Verify checks.
+func hash(v interface{}) (digest [sha256.Size]byte, err error) {
+	var buf bytes.Buffer
+	if err = gob.NewEncoder(&buf).Encode(v); err != nil {
+		return
+	}
+	return sha256.Sum256(buf.Bytes()), nil
+}
+
+// SignedRequestHeader pairs a RequestHeader with the signature binding it
+// to Signee.
+type SignedRequestHeader struct {
+	RequestHeader
+	Signee    *asymmetric.PublicKey
+	Signature *asymmetric.Signature
+}
+
+// Sign signs h.RequestHeader with signer, setting h.Signature.
+func (h *SignedRequestHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	digest, err := hash(h.RequestHeader)
+	if err != nil {
+		return
+	}
+	h.Signature, err = signer.Sign(digest[:])
+	return
+}
+
+// Verify reports whether h.Signature matches h.RequestHeader under
+// h.Signee.
+func (h *SignedRequestHeader) Verify() (err error) {
+	digest, err := hash(h.RequestHeader)
+	if err != nil {
+		return
+	}
+	if h.Signature == nil || !h.Signature.Verify(digest[:], h.Signee) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+// RequestPayload carries the statements a ReadQuery/WriteQuery executes.
+// It is empty for every transaction-control QueryType.
+type RequestPayload struct {
+	Queries []storage.Query
+}
+
+// Request is one signed call to a node's DBS.Query method.
+type Request struct {
+	Header  SignedRequestHeader
+	Payload RequestPayload
+}
+
+// Sign signs r.Header.
+func (r *Request) Sign(signer *asymmetric.PrivateKey) error {
+	return r.Header.Sign(signer)
+}
+
+// ResponseHeader carries the result metadata for a Request.
+type ResponseHeader struct {
+	Request   RequestHeader
+	NodeID    proto.NodeID
+	Timestamp time.Time
+	// CommitIndex is the log position Request was applied at (for a
+	// WriteQuery) or served as-of (for a ReadQuery), echoed back so the
+	// client can raise its own MinCommitIndex floor for later reads
+	// instead of relying on an unrelated local counter.
+	CommitIndex uint64
+	RowCount    uint64
+}
+
+// SignedResponseHeader pairs a ResponseHeader with the signature binding
+// it to Signee.
+type SignedResponseHeader struct {
+	ResponseHeader
+	Signee    *asymmetric.PublicKey
+	Signature *asymmetric.Signature
+}
+
+// Sign signs h.ResponseHeader with signer, setting h.Signature.
+func (h *SignedResponseHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	digest, err := hash(h.ResponseHeader)
+	if err != nil {
+		return
+	}
+	h.Signature, err = signer.Sign(digest[:])
+	return
+}
+
+// Verify reports whether h.Signature matches h.ResponseHeader under
+// h.Signee.
+func (h *SignedResponseHeader) Verify() (err error) {
+	digest, err := hash(h.ResponseHeader)
+	if err != nil {
+		return
+	}
+	if h.Signature == nil || !h.Signature.Verify(digest[:], h.Signee) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+// ResponsePayload carries the rows a ReadQuery produced. It is empty for
+// a WriteQuery or a transaction-control QueryType.
+type ResponsePayload struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// Response is the reply to a Request.
+type Response struct {
+	Header  SignedResponseHeader
+	Payload ResponsePayload
+}
+
+// Verify reports whether Header's signature is valid.
+func (r *Response) Verify() error {
+	return r.Header.Verify()
+}
+
+// AckHeader carries the node being acknowledged and when.
+type AckHeader struct {
+	Response  SignedResponseHeader
+	NodeID    proto.NodeID
+	Timestamp time.Time
+}
+
+// SignedAckHeader pairs an AckHeader with the signature binding it to
+// Signee.
+type SignedAckHeader struct {
+	AckHeader
+	Signee    *asymmetric.PublicKey
+	Signature *asymmetric.Signature
+}
+
+// Sign signs h.AckHeader with signer, setting h.Signature.
+func (h *SignedAckHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	digest, err := hash(h.AckHeader)
+	if err != nil {
+		return
+	}
+	h.Signature, err = signer.Sign(digest[:])
+	return
+}
+
+// Verify reports whether h.Signature matches h.AckHeader under h.Signee.
+func (h *SignedAckHeader) Verify() (err error) {
+	digest, err := hash(h.AckHeader)
+	if err != nil {
+		return
+	}
+	if h.Signature == nil || !h.Signature.Verify(digest[:], h.Signee) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+// Ack is a client's best-effort acknowledgement that it received a
+// Response, sent to a node's DBS.Ack method.
+type Ack struct {
+	Header SignedAckHeader
+}
+
+// Sign signs a.Header.
+func (a *Ack) Sign(signer *asymmetric.PrivateKey) error {
+	return a.Header.Sign(signer)
+}
+
+// AckResponse is the (normally ignored) reply to an Ack.
+type AckResponse struct {
+	Header SignedResponseHeader
+}